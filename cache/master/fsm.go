@@ -0,0 +1,238 @@
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hashicorp/raft"
+
+	"github.com/Focinfi/oncekv/log"
+)
+
+// commandType identifies the kind of mutation a Raft log entry carries
+type commandType string
+
+const (
+	cmdJoinNode   commandType = "joinNode"
+	cmdRemoveNode commandType = "removeNode"
+	cmdLeaveNode  commandType = "leaveNode"
+	cmdSyncDBs    commandType = "syncDBs"
+	cmdSetConfig  commandType = "setConfig"
+	cmdDemote     commandType = "demote"
+)
+
+// command is a single replicated mutation of the master's state, applied through the FSM.
+// Anything a command needs that would otherwise be computed inside Apply (e.g. a timestamp)
+// must be precomputed by the caller and carried here instead, so every replica (and a replica
+// restoring a snapshot taken by a different one) applies identical state.
+type command struct {
+	Type           commandType   `json:"type"`
+	HTTPAddr       string        `json:"httpAddr,omitempty"`
+	NodeAddr       string        `json:"nodeAddr,omitempty"`
+	JoinedAt       time.Time     `json:"joinedAt,omitempty"`
+	DBs            []string      `json:"dbs,omitempty"`
+	ActiveSize     int           `json:"activeSize,omitempty"`
+	PromotionDelay time.Duration `json:"promotionDelay,omitempty"`
+	MaxNodes       int           `json:"maxNodes,omitempty"`
+}
+
+// fsmSnapshot is the serializable form of the replicated state
+type fsmSnapshot struct {
+	NodesMap       nodesMap      `json:"nodesMap"`
+	DBs            []string      `json:"dbs"`
+	ActiveSize     int           `json:"activeSize"`
+	PromotionDelay time.Duration `json:"promotionDelay"`
+	MaxNodes       int           `json:"maxNodes"`
+	Epoch          uint64        `json:"epoch"`
+}
+
+// fsm adapts Master's replicated fields (nodesMap, dbs, config) to the raft.FSM interface.
+// It is a distinct type rather than methods on *Master so raft's reflection-free Apply/Snapshot/Restore
+// contract stays separate from the RPC-facing Master methods.
+type fsm Master
+
+func (f *fsm) master() *Master {
+	return (*Master)(f)
+}
+
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	var c command
+	if err := json.Unmarshal(l.Data, &c); err != nil {
+		return fmt.Errorf("%s fail unmarshal command, err: %v", logPrefix, err)
+	}
+
+	m := f.master()
+	switch c.Type {
+	case cmdJoinNode:
+		return m.applyJoinNode(c.HTTPAddr, c.NodeAddr, c.JoinedAt)
+	case cmdRemoveNode:
+		m.applyRemoveNode(c.HTTPAddr)
+		return nil
+	case cmdLeaveNode:
+		return m.applyLeaveNode(c.HTTPAddr)
+	case cmdSyncDBs:
+		m.Lock()
+		m.dbs = c.DBs
+		m.Unlock()
+		return nil
+	case cmdSetConfig:
+		m.Lock()
+		if c.ActiveSize > 0 {
+			m.activeSize = c.ActiveSize
+		}
+		if c.PromotionDelay > 0 {
+			m.promotionDelay = c.PromotionDelay
+		}
+		if c.MaxNodes > 0 {
+			m.maxNodes = c.MaxNodes
+		}
+		m.Unlock()
+		return nil
+	case cmdDemote:
+		m.Lock()
+		if info, ok := m.nodesMap[c.HTTPAddr]; ok {
+			info.Role = RoleStandby
+		}
+		m.Unlock()
+		return nil
+	default:
+		return fmt.Errorf("%s unknown command type: %s", logPrefix, c.Type)
+	}
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	m := f.master()
+	m.RLock()
+	defer m.RUnlock()
+
+	return &fsmSnapshotHolder{state: fsmSnapshot{
+		NodesMap:       m.nodesMap.clone(),
+		DBs:            append([]string{}, m.dbs...),
+		ActiveSize:     m.activeSize,
+		PromotionDelay: m.promotionDelay,
+		MaxNodes:       m.maxNodes,
+		Epoch:          m.epoch,
+	}}, nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	var state fsmSnapshot
+	if err := json.NewDecoder(rc).Decode(&state); err != nil {
+		return err
+	}
+
+	m := f.master()
+	m.Lock()
+	defer m.Unlock()
+
+	m.nodesMap = state.NodesMap
+	m.dbs = state.DBs
+	m.activeSize = state.ActiveSize
+	m.promotionDelay = state.PromotionDelay
+	m.maxNodes = state.MaxNodes
+	m.epoch = state.Epoch
+	return nil
+}
+
+type fsmSnapshotHolder struct {
+	state fsmSnapshot
+}
+
+func (s *fsmSnapshotHolder) Persist(sink raft.SnapshotSink) error {
+	b, err := json.Marshal(s.state)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	if _, err := sink.Write(b); err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s *fsmSnapshotHolder) Release() {}
+
+// applyJoinNode is the actual nodesMap mutation behind cmdJoinNode, run on every replica
+// so each master's applied state (and its meta-store mirror) stays in sync with the log.
+// joinedAt is computed by the caller (JoinNode) rather than here, since every replica must
+// apply this command identically and each replica's own time.Now() would diverge.
+func (m *Master) applyJoinNode(httpAddr, nodeAddr string, joinedAt time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	role := RoleStandby
+	if m.nodesMap.participantCount() < m.activeSize {
+		role = RoleParticipant
+	}
+
+	m.nodesMap[httpAddr] = &nodeInfo{
+		NodeAddr: nodeAddr,
+		Role:     role,
+		JoinedAt: joinedAt,
+	}
+
+	if err := m.updateNodesMap(m.nodesMap); err != nil {
+		log.DB.Errorln(logPrefix, "database error:", err)
+	}
+
+	return nil
+}
+
+// applyRemoveNode is the actual nodesMap mutation behind cmdRemoveNode, run on every replica.
+func (m *Master) applyRemoveNode(httpAddr string) {
+	m.Lock()
+	defer m.Unlock()
+
+	info, ok := m.nodesMap[httpAddr]
+	if !ok {
+		return
+	}
+
+	delete(m.nodesMap, httpAddr)
+
+	if info.Role == RoleParticipant {
+		if standby := m.nodesMap.oldestStandby(); standby != "" {
+			m.nodesMap[standby].Role = RoleParticipant
+			log.Biz.Infoln(logPrefix, standby, "promoted to participant")
+		}
+	}
+
+	if err := m.updateNodesMap(m.nodesMap); err != nil {
+		log.DB.Errorln(logPrefix, "database error:", err)
+	}
+
+	log.DB.Errorln(logPrefix, httpAddr, "removed")
+}
+
+// applyLeaveNode is the actual nodesMap mutation behind cmdLeaveNode, run on every replica.
+// Unlike applyRemoveNode (the heartbeat-failure path), it also bumps epoch so a heartbeat for
+// httpAddr already in flight when the leave is applied can't resurrect it.
+func (m *Master) applyLeaveNode(httpAddr string) uint64 {
+	m.Lock()
+	defer m.Unlock()
+
+	if info, ok := m.nodesMap[httpAddr]; ok {
+		delete(m.nodesMap, httpAddr)
+
+		if info.Role == RoleParticipant {
+			if standby := m.nodesMap.oldestStandby(); standby != "" {
+				m.nodesMap[standby].Role = RoleParticipant
+				log.Biz.Infoln(logPrefix, standby, "promoted to participant")
+			}
+		}
+
+		if err := m.updateNodesMap(m.nodesMap); err != nil {
+			log.DB.Errorln(logPrefix, "database error:", err)
+		}
+	}
+
+	m.epoch++
+	return m.epoch
+}
@@ -0,0 +1,152 @@
+package master
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// fakeMeta is a minimal in-memory meta.Meta so tests can exercise fsm.Apply without a
+// real backing store; applyJoinNode/applyRemoveNode/applyLeaveNode persist through it.
+type fakeMeta struct {
+	values map[string]string
+}
+
+func newFakeMeta() *fakeMeta {
+	return &fakeMeta{values: map[string]string{}}
+}
+
+func (f *fakeMeta) Get(key string) (string, error) {
+	return f.values[key], nil
+}
+
+func (f *fakeMeta) Put(key, value string) error {
+	f.values[key] = value
+	return nil
+}
+
+func (f *fakeMeta) WatchModify(key string, cb func()) {}
+
+func newTestMaster() *Master {
+	return &Master{
+		nodesMap:       nodesMap{},
+		activeSize:     2,
+		promotionDelay: time.Second,
+		maxNodes:       8,
+		meta:           newFakeMeta(),
+		nodesMapKey:    "nodes",
+	}
+}
+
+func applyCommand(t *testing.T, m *Master, c command) interface{} {
+	t.Helper()
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("marshal command: %v", err)
+	}
+
+	return (*fsm)(m).Apply(&raft.Log{Data: b})
+}
+
+func TestFSMApplyJoinNodeIsDeterministic(t *testing.T) {
+	m := newTestMaster()
+	joinedAt := time.Unix(1700000000, 0)
+
+	if err := applyCommand(t, m, command{Type: cmdJoinNode, HTTPAddr: "a", NodeAddr: "a-node", JoinedAt: joinedAt}); err != nil {
+		t.Fatalf("apply joinNode: %v", err)
+	}
+
+	info, ok := m.nodesMap["a"]
+	if !ok {
+		t.Fatalf("node a not present after join")
+	}
+
+	// JoinedAt must come from the command, not from fsm.Apply calling time.Now() itself,
+	// or replicas applying the same log entry would diverge on wall-clock state.
+	if !info.JoinedAt.Equal(joinedAt) {
+		t.Fatalf("JoinedAt = %v, want %v", info.JoinedAt, joinedAt)
+	}
+	if info.Role != RoleParticipant {
+		t.Fatalf("role = %v, want participant under activeSize", info.Role)
+	}
+}
+
+func TestFSMApplyJoinNodeOverActiveSizeIsStandby(t *testing.T) {
+	m := newTestMaster()
+	now := time.Unix(1700000000, 0)
+
+	for i, addr := range []string{"a", "b", "c"} {
+		applyCommand(t, m, command{Type: cmdJoinNode, HTTPAddr: addr, NodeAddr: addr + "-node", JoinedAt: now.Add(time.Duration(i) * time.Second)})
+	}
+
+	if m.nodesMap["c"].Role != RoleStandby {
+		t.Fatalf("3rd node over activeSize 2 = %v, want standby", m.nodesMap["c"].Role)
+	}
+}
+
+func TestFSMApplyLeaveNodeBumpsEpochAndPromotesStandby(t *testing.T) {
+	m := newTestMaster()
+	// activeSize 1 so a joins as the only participant and b as a standby
+	m.activeSize = 1
+	now := time.Unix(1700000000, 0)
+	applyCommand(t, m, command{Type: cmdJoinNode, HTTPAddr: "a", NodeAddr: "a-node", JoinedAt: now})
+	applyCommand(t, m, command{Type: cmdJoinNode, HTTPAddr: "b", NodeAddr: "b-node", JoinedAt: now.Add(time.Second)})
+
+	resp := applyCommand(t, m, command{Type: cmdLeaveNode, HTTPAddr: "a"})
+	epoch, ok := resp.(uint64)
+	if !ok || epoch != 1 {
+		t.Fatalf("leaveNode response = %#v, want epoch 1", resp)
+	}
+
+	if _, ok := m.nodesMap["a"]; ok {
+		t.Fatalf("node a still present after leaving")
+	}
+	if m.nodesMap["b"].Role != RoleParticipant {
+		t.Fatalf("standby b not promoted after participant a left")
+	}
+
+	resp2 := applyCommand(t, m, command{Type: cmdLeaveNode, HTTPAddr: "b"})
+	if epoch2, _ := resp2.(uint64); epoch2 != 2 {
+		t.Fatalf("epoch after second leave = %v, want 2", resp2)
+	}
+}
+
+func TestFSMApplySetConfig(t *testing.T) {
+	m := newTestMaster()
+	applyCommand(t, m, command{Type: cmdSetConfig, ActiveSize: 5, PromotionDelay: 2 * time.Second, MaxNodes: 10})
+
+	if m.activeSize != 5 {
+		t.Fatalf("activeSize = %d, want 5", m.activeSize)
+	}
+	if m.promotionDelay != 2*time.Second {
+		t.Fatalf("promotionDelay = %v, want 2s", m.promotionDelay)
+	}
+	if m.maxNodes != 10 {
+		t.Fatalf("maxNodes = %d, want 10", m.maxNodes)
+	}
+}
+
+func TestFSMApplySyncDBsAndDemote(t *testing.T) {
+	m := newTestMaster()
+	applyCommand(t, m, command{Type: cmdSyncDBs, DBs: []string{"db1", "db2"}})
+	if len(m.dbs) != 2 {
+		t.Fatalf("dbs = %v, want 2 entries", m.dbs)
+	}
+
+	applyCommand(t, m, command{Type: cmdJoinNode, HTTPAddr: "a", NodeAddr: "a-node", JoinedAt: time.Unix(1700000000, 0)})
+	applyCommand(t, m, command{Type: cmdDemote, HTTPAddr: "a"})
+	if m.nodesMap["a"].Role != RoleStandby {
+		t.Fatalf("demoted node role = %v, want standby", m.nodesMap["a"].Role)
+	}
+}
+
+func TestFSMApplyUnknownCommandErrors(t *testing.T) {
+	m := newTestMaster()
+	resp := applyCommand(t, m, command{Type: "bogus"})
+	if _, ok := resp.(error); !ok {
+		t.Fatalf("apply unknown command = %#v, want an error", resp)
+	}
+}
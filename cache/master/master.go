@@ -8,12 +8,16 @@ import (
 	"net"
 	"net/http"
 	"net/rpc"
+	"reflect"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/hashicorp/raft"
+
 	"github.com/Focinfi/oncekv/config"
 	"github.com/Focinfi/oncekv/db/master"
+	ocerrors "github.com/Focinfi/oncekv/errors"
 	"github.com/Focinfi/oncekv/log"
 	"github.com/Focinfi/oncekv/meta"
 	"github.com/Focinfi/oncekv/utils/mock"
@@ -24,6 +28,14 @@ const (
 	jsonHTTPHeader     = "application/json"
 	heartbeatURLFormat = "%s/meta"
 	logPrefix          = "cache/master:"
+
+	// defaultActiveSize is the default target number of full (participant) peers
+	defaultActiveSize = 3
+	// defaultPromotionDelay guards against flapping when demoting a participant
+	defaultPromotionDelay = 10 * time.Second
+	// defaultMaxNodes caps total joined nodes (participants plus standbys); JoinNode rejects
+	// any node beyond this with ocerrors.NewClusterFull
+	defaultMaxNodes = 32
 )
 
 var (
@@ -33,8 +45,40 @@ var (
 	httpPoster             = mock.HTTPPoster(mock.HTTPPosterFunc(http.Post))
 )
 
-// nodesMap is pairs of httpAddr/nodeAddr
-type nodesMap map[string]string
+// Role is the role of a node within the cluster
+type Role string
+
+const (
+	// RoleParticipant nodes are full groupcache peers
+	RoleParticipant Role = "participant"
+	// RoleStandby nodes are kept out of the groupcache ring and forward reads to participants
+	RoleStandby Role = "standby"
+)
+
+// nodeInfo is the master's bookkeeping record for a joined node
+type nodeInfo struct {
+	NodeAddr string    `json:"nodeAddr"`
+	Role     Role      `json:"role"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// nodesMap is keyed by httpAddr
+type nodesMap map[string]*nodeInfo
+
+// clone returns a deep copy of p: a new map holding copies of each *nodeInfo. Assigning the
+// map itself only copies the header, leaving the copy aliased to the live map and its
+// *nodeInfo values — ranging that after releasing m's lock would race applyJoinNode/
+// applyRemoveNode/applyLeaveNode/cmdDemote's in-place mutations under m.Lock(), and for a
+// map that's a fatal, unrecoverable crash rather than a benign race.
+func (p nodesMap) clone() nodesMap {
+	c := make(nodesMap, len(p))
+	for k, v := range p {
+		info := *v
+		c[k] = &info
+	}
+
+	return c
+}
 
 func (p nodesMap) httpAddrs() []string {
 	addrs := make([]string, len(p))
@@ -48,21 +92,85 @@ func (p nodesMap) httpAddrs() []string {
 	return addrs
 }
 
-func (p nodesMap) nodeAddrs() []string {
-	addrs := make([]string, len(p))
-	i := 0
-	for k := range p {
-		addrs[i] = p[k]
-		i++
+func (p nodesMap) participantHTTPAddrs() []string {
+	addrs := make([]string, 0, len(p))
+	for k, info := range p {
+		if info.Role == RoleParticipant {
+			addrs = append(addrs, k)
+		}
 	}
 
 	sort.StringSlice(addrs).Sort()
 	return addrs
 }
 
+func (p nodesMap) participantNodeAddrs() []string {
+	addrs := make([]string, 0, len(p))
+	for _, info := range p {
+		if info.Role == RoleParticipant {
+			addrs = append(addrs, info.NodeAddr)
+		}
+	}
+
+	sort.StringSlice(addrs).Sort()
+	return addrs
+}
+
+func (p nodesMap) participantCount() int {
+	count := 0
+	for _, info := range p {
+		if info.Role == RoleParticipant {
+			count++
+		}
+	}
+
+	return count
+}
+
+// oldestStandby returns the httpAddr of the longest-registered standby, or "" if none
+func (p nodesMap) oldestStandby() string {
+	var addr string
+	var joinedAt time.Time
+	for k, info := range p {
+		if info.Role != RoleStandby {
+			continue
+		}
+
+		if addr == "" || info.JoinedAt.Before(joinedAt) {
+			addr = k
+			joinedAt = info.JoinedAt
+		}
+	}
+
+	return addr
+}
+
+// newestParticipant returns the httpAddr of the participant with the latest JoinedAt, or "" if
+// none; promotion does not update JoinedAt, so this is the most recently joined participant
+func (p nodesMap) newestParticipant() string {
+	var addr string
+	var joinedAt time.Time
+	for k, info := range p {
+		if info.Role != RoleParticipant {
+			continue
+		}
+
+		if addr == "" || info.JoinedAt.After(joinedAt) {
+			addr = k
+			joinedAt = info.JoinedAt
+		}
+	}
+
+	return addr
+}
+
+// PeerParam is the peer/db info pushed to a node, either as a JoinNode reply or a heartbeat
 type PeerParam struct {
-	Peers []string `json:"peers"`
-	DBs   []string `json:"dbs"`
+	Peers            []string `json:"peers"`
+	DBs              []string `json:"dbs"`
+	Role             Role     `json:"role"`
+	ParticipantAddrs []string `json:"participantAddrs"`
+	Epoch            uint64   `json:"epoch"`
 }
 
 type JoinParam struct {
@@ -70,16 +178,59 @@ type JoinParam struct {
 	NodeAddr string `json:"nodeAddr"`
 }
 
+// LeaveParam is the RPC param for a node gracefully leaving the cluster
+type LeaveParam struct {
+	HTTPAddr string `json:"httpAddr"`
+}
+
+// LeaveReply carries the epoch the leave was applied at, so the leaving node can log it
+type LeaveReply struct {
+	Epoch uint64 `json:"epoch"`
+}
+
+// nodeView is the JSON view of a node exposed on /admin/nodes
+type nodeView struct {
+	HTTPAddr string    `json:"httpAddr"`
+	NodeAddr string    `json:"nodeAddr"`
+	Role     Role      `json:"role"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// adminConfigParam is the JSON body for /admin/config
+type adminConfigParam struct {
+	ActiveSize     int    `json:"activeSize"`
+	PromotionDelay string `json:"promotionDelay"`
+	MaxNodes       int    `json:"maxNodes"`
+}
+
 // Master for a group of caching nodes
 type Master struct {
 	// runtime data
 	sync.RWMutex
 	nodesMap nodesMap
 	dbs      []string
+	// epoch bumps on every graceful LeaveNode, so a reordered heartbeat can't resurrect
+	// a node that already left
+	epoch uint64
+
+	// tunable cluster growth policy
+	activeSize     int
+	promotionDelay time.Duration
+	// maxNodes caps total joined nodes (participants plus standbys); see defaultMaxNodes
+	maxNodes int
 
 	// http server
 	addr string
 
+	// raft replication, see fsm.go/raft.go; nodesMap/dbs/activeSize/promotionDelay are the FSM state.
+	// raftDir/peerAddrs are captured here at construction time but only acted on in Start,
+	// so building (or merely importing a package holding) a *Master has no side effects.
+	raft      *raft.Raft
+	raftAddr  string
+	raftDir   string
+	nodeID    string
+	peerAddrs []string
+
 	// database store
 	meta        meta.Meta
 	nodesMapKey string
@@ -88,12 +239,33 @@ type Master struct {
 // Default returns a new Master with the default addr
 var Default = New(defaultAddr)
 
-// New returns a new Master with the addr
+// New returns a new Master with the addr; call Start to run it as a standalone single-node
+// Raft cluster. For a highly-available multi-replica setup, use NewCluster.
 func New(addr string) *Master {
+	return NewCluster(addr, defaultRaftAddr, defaultNodeID, defaultRaftDir, defaultPeerAddrs)
+}
+
+// NewCluster returns a new Master replica participating in a Raft group identified by nodeID.
+// peerAddrs should list the master RPC addrs (the gin-free rpc.HandleHTTP mux each replica
+// serves on its own addr, same as JoinNode) of already-running replicas, NOT their raft
+// transport addrs: JoinRaftCluster is a master RPC method, dialed with rpc.DialHTTP, and the
+// raft transport speaks raft's own binary stream protocol rather than HTTP. An empty list
+// bootstraps a brand new single-node cluster that later replicas can join via JoinRaftCluster.
+// NewCluster itself only fetches the current nodesMap; the Raft group (its listener, raft
+// dir, and any join-cluster RPC) isn't set up until Start, so constructing a *Master has no
+// listening-socket/filesystem side effects.
+func NewCluster(addr, raftAddr, nodeID, raftDir string, peerAddrs []string) *Master {
 	m := &Master{
-		addr:        addr,
-		nodesMapKey: cacheNodesKey,
-		meta:        meta.Default,
+		addr:           addr,
+		nodesMapKey:    cacheNodesKey,
+		meta:           meta.Default,
+		activeSize:     defaultActiveSize,
+		promotionDelay: defaultPromotionDelay,
+		maxNodes:       defaultMaxNodes,
+		nodeID:         nodeID,
+		raftAddr:       raftAddr,
+		raftDir:        raftDir,
+		peerAddrs:      peerAddrs,
 	}
 
 	nodesMap, err := m.fetchNodesMap()
@@ -102,18 +274,36 @@ func New(addr string) *Master {
 	}
 
 	log.Biz.Infoln(logPrefix, "Nodes: ", nodesMap)
-
 	m.nodesMap = nodesMap
+
 	return m
 }
 
-// Start starts the master listening on addr
+// Start bootstraps this replica's Raft group (binding its raft transport, joining an existing
+// cluster if peerAddrs were configured at construction) and then starts serving HTTP/RPC on
+// addr. Raft setup happens here, not in New/NewCluster, so a *Master can be constructed (and
+// cache/master can be imported for its exported helpers, e.g. by cache/node) without binding
+// a port, creating a raft dir, or risking New's panic-on-error as an import-time side effect.
 func (m *Master) Start() {
+	bootstrap := len(m.peerAddrs) == 0
+	if err := m.bootstrapRaft(m.nodeID, m.raftAddr, m.raftDir, bootstrap); err != nil {
+		panic(err)
+	}
+
+	if !bootstrap {
+		if err := joinExistingRaftCluster(m.nodeID, m.raftAddr, m.peerAddrs); err != nil {
+			log.Internal.Errorln(logPrefix, "fail join raft cluster, err:", err)
+		}
+	}
+
 	go m.meta.WatchModify(m.nodesMapKey, func() { m.syncDBs() })
 	go m.heartbeat()
 
 	rpc.Register(m)
 	rpc.HandleHTTP()
+	http.HandleFunc("/admin/config", m.handleAdminConfig)
+	http.HandleFunc("/admin/nodes", m.handleAdminNodes)
+	http.HandleFunc("/v1/admin/members", m.handleAdminMembers)
 	l, e := net.Listen("tcp", m.addr)
 	if e != nil {
 		log.Internal.Fatal("listen error:", e)
@@ -121,14 +311,13 @@ func (m *Master) Start() {
 	go http.Serve(l, nil)
 }
 
-// Peers returns the httpAddrs
+// Peers returns the httpAddrs of the current participants, served from this replica's
+// locally applied state rather than the meta store directly
 func (m *Master) Peers() ([]string, error) {
-	peers, err := m.fetchNodesMap()
-	if err != nil {
-		return nil, err
-	}
+	m.RLock()
+	defer m.RUnlock()
 
-	return peers.httpAddrs(), nil
+	return m.nodesMap.participantHTTPAddrs(), nil
 }
 
 func (m *Master) setNodesMap(peers nodesMap) {
@@ -139,23 +328,91 @@ func (m *Master) setNodesMap(peers nodesMap) {
 }
 
 func (m *Master) JoinNode(args *JoinParam, reply *PeerParam) error {
-	if args == nil || args.HTTPAddr == "" || args.NodeAddr == "" {
-		return fmt.Errorf("%s wrong params", logPrefix)
+	if args == nil || args.HTTPAddr == "" {
+		return ocerrors.NewBadJoinParams("httpAddr")
 	}
 
-	m.Lock()
-	m.nodesMap[urlutil.MakeURL(args.HTTPAddr)] = urlutil.MakeURL(args.NodeAddr)
-	if err := m.updateNodesMap(m.nodesMap); err != nil {
-		m.Unlock()
-		return fmt.Errorf("%s fail updateNodesMap, err: %v", logPrefix, err)
+	if args.NodeAddr == "" {
+		return ocerrors.NewBadJoinParams("nodeAddr")
+	}
+
+	httpAddr := urlutil.MakeURL(args.HTTPAddr)
+	nodeAddr := urlutil.MakeURL(args.NodeAddr)
+
+	m.RLock()
+	_, alreadyJoined := m.nodesMap[httpAddr]
+	full := !alreadyJoined && len(m.nodesMap) >= m.maxNodes
+	m.RUnlock()
+	if full {
+		return ocerrors.NewClusterFull()
 	}
 
-	*reply = PeerParam{Peers: m.nodesMap.httpAddrs(), DBs: m.dbs}
-	m.Unlock()
+	// JoinedAt is computed here rather than inside fsm.Apply: every replica must apply an
+	// identical command, and each replica's own time.Now() would diverge the wall-clock
+	// JoinedAt (and everything oldestStandby/newestParticipant decide from it) between replicas.
+	if _, err := m.apply(command{Type: cmdJoinNode, HTTPAddr: httpAddr, NodeAddr: nodeAddr, JoinedAt: time.Now()}, raftTimeout); err != nil {
+		return fmt.Errorf("%s fail apply joinNode, err: %v", logPrefix, err)
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+
+	info, ok := m.nodesMap[httpAddr]
+	if !ok {
+		// Left again between the apply above and this read; report it rather than
+		// panicking the RPC handler goroutine on a nil *nodeInfo.
+		return fmt.Errorf("%s node %s left immediately after joining", logPrefix, httpAddr)
+	}
+
+	*reply = PeerParam{
+		Peers:            m.nodesMap.participantNodeAddrs(),
+		DBs:              m.dbs,
+		Role:             info.Role,
+		ParticipantAddrs: m.nodesMap.participantHTTPAddrs(),
+		Epoch:            m.epoch,
+	}
 	log.DB.Infoln("join:", m.nodesMap)
 	return nil
 }
 
+// LeaveNode synchronously removes node from the cluster, bumps the membership epoch so a
+// reordered heartbeat can't resurrect it, and pushes the new peer list to every remaining
+// node before returning, closing the stale-peer window a silent drop-on-heartbeat-failure
+// would otherwise leave open.
+func (m *Master) LeaveNode(args *LeaveParam, reply *LeaveReply) error {
+	if args == nil || args.HTTPAddr == "" {
+		return ocerrors.NewBadJoinParams("httpAddr")
+	}
+
+	httpAddr := urlutil.MakeURL(args.HTTPAddr)
+	resp, err := m.apply(command{Type: cmdLeaveNode, HTTPAddr: httpAddr}, raftTimeout)
+	if err != nil {
+		return fmt.Errorf("%s fail apply leaveNode, err: %v", logPrefix, err)
+	}
+
+	epoch, _ := resp.(uint64)
+	*reply = LeaveReply{Epoch: epoch}
+
+	m.RLock()
+	nodesMap := m.nodesMap.clone()
+	m.RUnlock()
+
+	var wg sync.WaitGroup
+	for addr, info := range nodesMap {
+		wg.Add(1)
+		go func(addr string, role Role) {
+			defer wg.Done()
+			if err := m.sendPeers(addr, role, nodesMap.participantNodeAddrs(), nodesMap.participantHTTPAddrs(), epoch); err != nil {
+				log.Internal.Errorln(logPrefix, "node error:", err)
+			}
+		}(addr, info.Role)
+	}
+	wg.Wait()
+
+	log.Biz.Infoln(logPrefix, httpAddr, "left at epoch", epoch)
+	return nil
+}
+
 func (m *Master) fetchNodesMap() (nodesMap, error) {
 	nodes := nodesMap{}
 
@@ -180,34 +437,39 @@ func (m *Master) updateNodesMap(peers nodesMap) error {
 	return m.meta.Put(m.nodesMapKey, string(b))
 }
 
-// heartbeat for check the nodes health periodicly
+// heartbeat for check the nodes health periodicly. Only the Raft leader drives heartbeats;
+// followers would otherwise all concurrently try to remove the same unresponsive node.
 func (m *Master) heartbeat() {
 	ticker := time.NewTicker(defaultHeartbeatPeriod)
 	for {
 		<-ticker.C
+		if m.raft.State() != raft.Leader {
+			continue
+		}
+
 		m.RLock()
-		nodesMap := m.nodesMap
+		nodesMap := m.nodesMap.clone()
+		epoch := m.epoch
 		m.RUnlock()
 
-		nodePeers := nodesMap.nodeAddrs()
-		for _, nodeURL := range nodesMap.httpAddrs() {
-			go func(node string) {
-				err := m.sendPeers(node, nodePeers)
+		for httpAddr, info := range nodesMap {
+			go func(httpAddr string, role Role) {
+				err := m.sendPeers(httpAddr, role, nodesMap.participantNodeAddrs(), nodesMap.participantHTTPAddrs(), epoch)
 				if err != nil {
 					log.Internal.Errorln(logPrefix, "node error:", err)
-					m.removeNode(node)
+					m.removeNode(httpAddr)
 				}
-			}(nodeURL)
+			}(httpAddr, info.Role)
 		}
 	}
 }
 
-func (m *Master) sendPeers(node string, nodes []string) error {
+func (m *Master) sendPeers(node string, role Role, peers []string, participantAddrs []string, epoch uint64) error {
 	if err := m.syncDBs(); err != nil {
 		return err
 	}
 
-	params := PeerParam{Peers: nodes, DBs: m.dbs}
+	params := PeerParam{Peers: peers, DBs: m.dbs, Role: role, ParticipantAddrs: participantAddrs, Epoch: epoch}
 
 	b, err := json.Marshal(&params)
 	if err != nil {
@@ -230,31 +492,131 @@ func (m *Master) sendPeers(node string, nodes []string) error {
 }
 
 func (m *Master) removeNode(node string) {
-	m.Lock()
-	if _, ok := m.nodesMap[node]; !ok {
-		m.Unlock()
-		return
+	if _, err := m.apply(command{Type: cmdRemoveNode, HTTPAddr: node}, raftTimeout); err != nil {
+		log.Internal.Errorln(logPrefix, "fail apply removeNode, err:", err)
 	}
+}
 
-	delete(m.nodesMap, node)
+// demoteExcessParticipant waits promotionDelay and then demotes the newest participant
+// if the participant count is still over activeSize, to avoid flapping on transient overflows
+func (m *Master) demoteExcessParticipant() {
+	m.RLock()
+	overflow := m.nodesMap.participantCount() > m.activeSize
+	delay := m.promotionDelay
+	m.RUnlock()
 
-	if err := m.updateNodesMap(m.nodesMap); err != nil {
-		log.DB.Errorln(logPrefix, "database error:", err)
+	if !overflow {
+		return
 	}
 
-	log.DB.Errorln(logPrefix, node, "removed")
-	m.Unlock()
+	time.AfterFunc(delay, func() {
+		m.RLock()
+		stillOverflowing := m.nodesMap.participantCount() > m.activeSize
+		newest := m.nodesMap.newestParticipant()
+		m.RUnlock()
+
+		if !stillOverflowing || newest == "" {
+			return
+		}
+
+		if _, err := m.apply(command{Type: cmdDemote, HTTPAddr: newest}, raftTimeout); err != nil {
+			log.Internal.Errorln(logPrefix, "fail apply demote, err:", err)
+			return
+		}
+
+		log.Biz.Infoln(logPrefix, newest, "demoted to standby")
+	})
 }
 
 func (m *Master) syncDBs() error {
+	if m.raft.State() != raft.Leader {
+		return nil
+	}
+
 	dbs, err := master.Default.Peers()
 	if err != nil {
 		return err
 	}
 
-	m.Lock()
-	defer m.Unlock()
-	m.dbs = dbs
+	m.RLock()
+	unchanged := reflect.DeepEqual(dbs, m.dbs)
+	m.RUnlock()
+	if unchanged {
+		return nil
+	}
 
-	return nil
+	_, err = m.apply(command{Type: cmdSyncDBs, DBs: dbs}, raftTimeout)
+	return err
+}
+
+func (m *Master) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		m.RLock()
+		cfg := adminConfigParam{ActiveSize: m.activeSize, PromotionDelay: m.promotionDelay.String(), MaxNodes: m.maxNodes}
+		m.RUnlock()
+
+		writeJSON(w, http.StatusOK, cfg)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params adminConfigParam
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, fmt.Sprintf("%s bad params, err: %v", logPrefix, err), http.StatusBadRequest)
+		return
+	}
+
+	c := command{ActiveSize: params.ActiveSize, MaxNodes: params.MaxNodes}
+	c.Type = cmdSetConfig
+	if params.PromotionDelay != "" {
+		delay, err := time.ParseDuration(params.PromotionDelay)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s bad promotionDelay, err: %v", logPrefix, err), http.StatusBadRequest)
+			return
+		}
+
+		c.PromotionDelay = delay
+	}
+
+	if _, err := m.apply(c, raftTimeout); err != nil {
+		http.Error(w, fmt.Sprintf("%s fail apply config, err: %v", logPrefix, err), http.StatusServiceUnavailable)
+		return
+	}
+
+	go m.demoteExcessParticipant()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *Master) handleAdminNodes(w http.ResponseWriter, r *http.Request) {
+	m.RLock()
+	views := make([]nodeView, 0, len(m.nodesMap))
+	for httpAddr, info := range m.nodesMap {
+		views = append(views, nodeView{
+			HTTPAddr: httpAddr,
+			NodeAddr: info.NodeAddr,
+			Role:     info.Role,
+			JoinedAt: info.JoinedAt,
+		})
+	}
+	m.RUnlock()
+
+	sort.Slice(views, func(i, j int) bool { return views[i].HTTPAddr < views[j].HTTPAddr })
+	writeJSON(w, http.StatusOK, views)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonHTTPHeader)
+	w.WriteHeader(status)
+	w.Write(b)
 }
@@ -0,0 +1,228 @@
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+
+	"github.com/Focinfi/oncekv/config"
+	ocerrors "github.com/Focinfi/oncekv/errors"
+	"github.com/Focinfi/oncekv/log"
+)
+
+const (
+	raftTimeout          = 10 * time.Second
+	raftTransportMaxPool = 3
+	retainSnapshotCount  = 2
+
+	// NotLeaderErrPrefix prefixes RPC errors returned by a non-leader replica; the
+	// leader's raft addr follows the prefix so callers can redirect straight to it.
+	NotLeaderErrPrefix = "not leader, try: "
+)
+
+var (
+	defaultRaftAddr = config.Config.CacheMasterRaftAddr
+	defaultRaftDir  = config.Config.CacheMasterRaftDir
+	defaultNodeID   = config.Config.CacheMasterNodeID
+	// defaultPeerAddrs lists the master RPC addrs (not raft transport addrs) of already-running
+	// replicas, for joinExistingRaftCluster to dial with rpc.DialHTTP
+	defaultPeerAddrs = config.Config.CacheMasterPeerAddrs
+)
+
+// RaftJoinParam is the RPC param for an existing master adding a new replica as a voter
+type RaftJoinParam struct {
+	NodeID   string `json:"nodeID"`
+	RaftAddr string `json:"raftAddr"`
+}
+
+// memberView is the JSON view of a single master replica exposed on /v1/admin/members
+type memberView struct {
+	ID       string `json:"id"`
+	RaftAddr string `json:"raftAddr"`
+	Leader   bool   `json:"leader"`
+}
+
+// bootstrapRaft wires up the embedded Raft group backing this master's replicated state.
+// bootstrap is true only for the first node of a brand new cluster; replicas joining an
+// existing cluster instead call JoinRaftCluster on the leader once they're listening.
+func (m *Master) bootstrapRaft(nodeID, raftAddr, raftDir string, bootstrap bool) error {
+	config := raft.DefaultConfig()
+	config.LocalID = raft.ServerID(nodeID)
+
+	addr, err := net.ResolveTCPAddr("tcp", raftAddr)
+	if err != nil {
+		return fmt.Errorf("%s fail resolve raft addr, err: %v", logPrefix, err)
+	}
+
+	transport, err := raft.NewTCPTransport(raftAddr, addr, raftTransportMaxPool, raftTimeout, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("%s fail new raft transport, err: %v", logPrefix, err)
+	}
+
+	if err := os.MkdirAll(raftDir, 0755); err != nil {
+		return fmt.Errorf("%s fail mkdir raft dir, err: %v", logPrefix, err)
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(raftDir, retainSnapshotCount, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("%s fail new snapshot store, err: %v", logPrefix, err)
+	}
+
+	logStore, err := raftboltdb.NewBoltStore(filepath.Join(raftDir, "raft.db"))
+	if err != nil {
+		return fmt.Errorf("%s fail new bolt store, err: %v", logPrefix, err)
+	}
+
+	r, err := raft.NewRaft(config, (*fsm)(m), logStore, logStore, snapshots, transport)
+	if err != nil {
+		return fmt.Errorf("%s fail new raft, err: %v", logPrefix, err)
+	}
+
+	if bootstrap {
+		r.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{{ID: config.LocalID, Address: transport.LocalAddr()}},
+		})
+	}
+
+	m.nodeID = nodeID
+	m.raftAddr = raftAddr
+	m.raft = r
+	return nil
+}
+
+// apply marshals a command and runs it through the Raft log, returning a not-leader
+// error (carrying the current leader's address) if this replica can't accept writes.
+func (m *Master) apply(c command, timeout time.Duration) (interface{}, error) {
+	if m.raft.State() != raft.Leader {
+		return nil, fmt.Errorf("%s%s%s", logPrefix, NotLeaderErrPrefix, m.raft.Leader())
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	future := m.raft.Apply(b, timeout)
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+
+	if err, ok := future.Response().(error); ok && err != nil {
+		return nil, err
+	}
+
+	return future.Response(), nil
+}
+
+// JoinRaftCluster is called by a new master replica against the current leader to be
+// added as a voter, the master-cluster analogue of Node.join for cache nodes.
+func (m *Master) JoinRaftCluster(args *RaftJoinParam, reply *struct{}) error {
+	if args == nil || args.NodeID == "" || args.RaftAddr == "" {
+		return ocerrors.NewBadJoinParams("nodeID/raftAddr")
+	}
+
+	if m.raft.State() != raft.Leader {
+		return fmt.Errorf("%s%s%s", logPrefix, NotLeaderErrPrefix, m.raft.Leader())
+	}
+
+	future := m.raft.AddVoter(raft.ServerID(args.NodeID), raft.ServerAddress(args.RaftAddr), 0, raftTimeout)
+	if err := future.Error(); err != nil {
+		return fmt.Errorf("%s fail add voter, err: %v", logPrefix, err)
+	}
+
+	log.Biz.Infoln(logPrefix, args.NodeID, "joined raft cluster at", args.RaftAddr)
+	return nil
+}
+
+// parseNotLeaderAddr extracts the leader addr from a NotLeaderErrPrefix error, or "" if err
+// doesn't match; mirrors cache/node's parseNotLeaderAddr for the master-to-master raft join.
+func parseNotLeaderAddr(err error) string {
+	idx := strings.Index(err.Error(), NotLeaderErrPrefix)
+	if idx < 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(err.Error()[idx+len(NotLeaderErrPrefix):])
+}
+
+// nextPeerAddr returns the peer addr immediately after cur in peerAddrs, wrapping around;
+// if cur isn't a known addr (e.g. a redirect target) it starts back from the top.
+func nextPeerAddr(cur string, peerAddrs []string) string {
+	for i, addr := range peerAddrs {
+		if addr == cur {
+			return peerAddrs[(i+1)%len(peerAddrs)]
+		}
+	}
+
+	return peerAddrs[0]
+}
+
+// joinExistingRaftCluster dials each known peer master's RPC addr (the same addr JoinNode
+// dials, not its raft transport addr), following "not leader, try: <addr>" redirects the
+// same way cache/node's callMaster does, until one (the leader, or one that redirects to
+// it) accepts this replica as a voter.
+func joinExistingRaftCluster(selfNodeID, selfRaftAddr string, peerAddrs []string) error {
+	if len(peerAddrs) == 0 {
+		return fmt.Errorf("%s fail join raft cluster: no peer addrs configured", logPrefix)
+	}
+
+	args := &RaftJoinParam{NodeID: selfNodeID, RaftAddr: selfRaftAddr}
+	addr := peerAddrs[0]
+	var lastErr error
+	for attempt := 0; attempt < len(peerAddrs); attempt++ {
+		client, err := rpc.DialHTTP("tcp", addr)
+		if err != nil {
+			lastErr = err
+			addr = nextPeerAddr(addr, peerAddrs)
+			continue
+		}
+
+		reply := &struct{}{}
+		err = client.Call("Master.JoinRaftCluster", args, reply)
+		client.Close()
+		if err == nil {
+			return nil
+		}
+
+		lastErr = err
+		if leader := parseNotLeaderAddr(err); leader != "" {
+			addr = leader
+			continue
+		}
+
+		addr = nextPeerAddr(addr, peerAddrs)
+	}
+
+	return fmt.Errorf("%s fail join raft cluster via %v, last err: %v", logPrefix, peerAddrs, lastErr)
+}
+
+// handleAdminMembers lists the master cluster's Raft configuration for observability
+func (m *Master) handleAdminMembers(w http.ResponseWriter, r *http.Request) {
+	future := m.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	leader := m.raft.Leader()
+	servers := future.Configuration().Servers
+	views := make([]memberView, 0, len(servers))
+	for _, s := range servers {
+		views = append(views, memberView{
+			ID:       string(s.ID),
+			RaftAddr: string(s.Address),
+			Leader:   s.Address == leader,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, views)
+}
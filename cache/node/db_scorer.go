@@ -0,0 +1,221 @@
+package node
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// circuitState is a per-db circuit-breaker state, closed/open/half-open as in the
+// standard circuit-breaker pattern
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+const (
+	// ewmaAlpha weights the latest latency sample against the running EWMA
+	ewmaAlpha = 0.2
+	// errWindowSize is the number of recent outcomes tracked per db for the error rate
+	errWindowSize = 20
+	// errRateThreshold trips the circuit once this fraction of the window is errors
+	errRateThreshold = 0.5
+	// minSamplesToTrip avoids tripping the circuit on the first couple of requests
+	minSamplesToTrip = 5
+	// openTimeout is how long a circuit stays open before allowing a half-open probe
+	openTimeout = 5 * time.Second
+	// defaultHedgeDelay is used for a db with no latency samples yet
+	defaultHedgeDelay = 50 * time.Millisecond
+)
+
+// dbStat is one db's rolling health record
+type dbStat struct {
+	latencyEWMA time.Duration
+	errWindow   []bool // true entries are errors, oldest first
+	state       circuitState
+	openedAt    time.Time
+	probing     bool
+}
+
+func (s *dbStat) errorRate() float64 {
+	if len(s.errWindow) == 0 {
+		return 0
+	}
+
+	errs := 0
+	for _, e := range s.errWindow {
+		if e {
+			errs++
+		}
+	}
+
+	return float64(errs) / float64(len(s.errWindow))
+}
+
+func (s *dbStat) recordOutcome(isErr bool) {
+	s.errWindow = append(s.errWindow, isErr)
+	if len(s.errWindow) > errWindowSize {
+		s.errWindow = s.errWindow[1:]
+	}
+}
+
+// dbStatView is the JSON view of a single db's health exposed on /stats and /ws/stats
+type dbStatView struct {
+	URL        string  `json:"url"`
+	LatencyMS  float64 `json:"latencyMs"`
+	ErrorRate  float64 `json:"errorRate"`
+	State      string  `json:"state"`
+	NumSamples int     `json:"numSamples"`
+}
+
+// dbScorer tracks per-db latency/health and gates traffic with a circuit breaker,
+// replacing the old single fastDB heuristic so fetchData can rank and hedge across dbs.
+type dbScorer struct {
+	mu    sync.Mutex
+	stats map[string]*dbStat
+}
+
+func newDBScorer() *dbScorer {
+	return &dbScorer{stats: map[string]*dbStat{}}
+}
+
+func (s *dbScorer) statFor(db string) *dbStat {
+	st, ok := s.stats[db]
+	if !ok {
+		st = &dbStat{}
+		s.stats[db] = st
+	}
+
+	return st
+}
+
+func (s *dbScorer) recordSuccess(db string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.statFor(db)
+	if st.latencyEWMA == 0 {
+		st.latencyEWMA = latency
+	} else {
+		st.latencyEWMA = time.Duration(ewmaAlpha*float64(latency) + (1-ewmaAlpha)*float64(st.latencyEWMA))
+	}
+
+	st.recordOutcome(false)
+	if st.state != circuitClosed {
+		st.state = circuitClosed
+		st.probing = false
+		// Drop the failure history that tripped the breaker; otherwise a closed circuit
+		// still carrying a mostly-error window would re-trip on the very next failure,
+		// defeating the half-open probe this success just passed.
+		st.errWindow = nil
+	}
+}
+
+func (s *dbScorer) recordFailure(db string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.statFor(db)
+	st.recordOutcome(true)
+	st.probing = false
+
+	if st.state == circuitClosed &&
+		len(st.errWindow) >= minSamplesToTrip &&
+		st.errorRate() >= errRateThreshold {
+		st.state = circuitOpen
+		st.openedAt = time.Now()
+		return
+	}
+
+	if st.state == circuitHalfOpen {
+		st.state = circuitOpen
+		st.openedAt = time.Now()
+	}
+}
+
+// rank returns dbs ordered best-first: closed circuits by ascending latency, then at
+// most one half-open probe candidate if every circuit is currently open.
+func (s *dbScorer) rank(dbs []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	healthy := make([]string, 0, len(dbs))
+	var probeCandidate string
+	var probeOpenedAt time.Time
+
+	for _, db := range dbs {
+		st := s.statFor(db)
+
+		if st.state == circuitOpen && time.Since(st.openedAt) >= openTimeout {
+			st.state = circuitHalfOpen
+		}
+
+		switch st.state {
+		case circuitClosed:
+			healthy = append(healthy, db)
+		case circuitHalfOpen:
+			if !st.probing && (probeCandidate == "" || st.openedAt.Before(probeOpenedAt)) {
+				probeCandidate = db
+				probeOpenedAt = st.openedAt
+			}
+		}
+	}
+
+	sort.Slice(healthy, func(i, j int) bool {
+		return s.statFor(healthy[i]).latencyEWMA < s.statFor(healthy[j]).latencyEWMA
+	})
+
+	if len(healthy) == 0 && probeCandidate != "" {
+		s.statFor(probeCandidate).probing = true
+		return []string{probeCandidate}
+	}
+
+	return healthy
+}
+
+// hedgeDelay returns how long to wait for db's primary response before firing a
+// hedged request to the next-best db
+func (s *dbScorer) hedgeDelay(db string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st := s.statFor(db); st.latencyEWMA > 0 {
+		return st.latencyEWMA
+	}
+
+	return defaultHedgeDelay
+}
+
+// Snapshot returns the current health of every tracked db, for /stats and /ws/stats
+func (s *dbScorer) Snapshot() []dbStatView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	views := make([]dbStatView, 0, len(s.stats))
+	for db, st := range s.stats {
+		views = append(views, dbStatView{
+			URL:        db,
+			LatencyMS:  float64(st.latencyEWMA) / float64(time.Millisecond),
+			ErrorRate:  st.errorRate(),
+			State:      st.state.String(),
+			NumSamples: len(st.errWindow),
+		})
+	}
+
+	sort.Slice(views, func(i, j int) bool { return views[i].URL < views[j].URL })
+	return views
+}
@@ -0,0 +1,97 @@
+package node
+
+import (
+	"testing"
+	"time"
+)
+
+func tripCircuit(s *dbScorer, db string) {
+	for i := 0; i < minSamplesToTrip; i++ {
+		s.recordFailure(db)
+	}
+}
+
+func TestDBScorerTripsCircuitOnSustainedFailures(t *testing.T) {
+	s := newDBScorer()
+	tripCircuit(s, "db1")
+
+	if ranked := s.rank([]string{"db1"}); len(ranked) != 0 {
+		t.Fatalf("rank = %v, want empty while circuit open and before openTimeout", ranked)
+	}
+}
+
+func TestDBScorerHalfOpensAfterTimeoutAndProbes(t *testing.T) {
+	s := newDBScorer()
+	tripCircuit(s, "db1")
+
+	s.mu.Lock()
+	s.stats["db1"].openedAt = time.Now().Add(-2 * openTimeout)
+	s.mu.Unlock()
+
+	ranked := s.rank([]string{"db1"})
+	if len(ranked) != 1 || ranked[0] != "db1" {
+		t.Fatalf("rank = %v, want a single half-open probe candidate db1", ranked)
+	}
+
+	s.mu.Lock()
+	state, probing := s.stats["db1"].state, s.stats["db1"].probing
+	s.mu.Unlock()
+	if state != circuitHalfOpen || !probing {
+		t.Fatalf("state=%v probing=%v, want half-open and probing after being ranked", state, probing)
+	}
+}
+
+func TestDBScorerRecordSuccessClosesCircuit(t *testing.T) {
+	s := newDBScorer()
+	tripCircuit(s, "db1")
+	s.recordSuccess("db1", 10*time.Millisecond)
+
+	s.mu.Lock()
+	state := s.stats["db1"].state
+	s.mu.Unlock()
+	if state != circuitClosed {
+		t.Fatalf("state = %v, want closed after a success", state)
+	}
+
+	if ranked := s.rank([]string{"db1"}); len(ranked) != 1 || ranked[0] != "db1" {
+		t.Fatalf("rank = %v, want db1 healthy again", ranked)
+	}
+}
+
+func TestDBScorerRecoveredCircuitSurvivesASingleFailure(t *testing.T) {
+	s := newDBScorer()
+	tripCircuit(s, "db1")
+	s.recordSuccess("db1", 10*time.Millisecond)
+
+	s.recordFailure("db1")
+
+	s.mu.Lock()
+	state := s.stats["db1"].state
+	s.mu.Unlock()
+	if state != circuitClosed {
+		t.Fatalf("state = %v, want a single post-recovery failure to stay closed", state)
+	}
+}
+
+func TestDBScorerRanksHealthyByLatency(t *testing.T) {
+	s := newDBScorer()
+	s.recordSuccess("slow", 100*time.Millisecond)
+	s.recordSuccess("fast", 10*time.Millisecond)
+
+	ranked := s.rank([]string{"slow", "fast"})
+	if len(ranked) != 2 || ranked[0] != "fast" || ranked[1] != "slow" {
+		t.Fatalf("rank = %v, want [fast slow]", ranked)
+	}
+}
+
+func TestDBScorerHedgeDelay(t *testing.T) {
+	s := newDBScorer()
+	if d := s.hedgeDelay("unknown"); d != defaultHedgeDelay {
+		t.Fatalf("hedgeDelay for unseen db = %v, want default %v", d, defaultHedgeDelay)
+	}
+
+	s.recordSuccess("db1", 42*time.Millisecond)
+	if d := s.hedgeDelay("db1"); d != 42*time.Millisecond {
+		t.Fatalf("hedgeDelay = %v, want EWMA 42ms", d)
+	}
+}
@@ -1,19 +1,26 @@
 package node
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/rpc"
+	"os"
+	"os/signal"
 	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Focinfi/oncekv/cache/master"
 	"github.com/Focinfi/oncekv/config"
+	ocerrors "github.com/Focinfi/oncekv/errors"
 	"github.com/Focinfi/oncekv/log"
 	"github.com/Focinfi/oncekv/utils/mock"
 	"github.com/Focinfi/oncekv/utils/urlutil"
@@ -27,17 +34,17 @@ const (
 	basePath       = "/oncekv/"
 	defaultGroup   = "kv"
 	dbGetURLFormat = "%s/i/key/%s"
+	keyURLFormat   = "%s/key/%s"
 	logPrefix      = "cache/node:"
+
+	initialJoinBackoff = 100 * time.Millisecond
+	maxJoinBackoff     = 30 * time.Second
 )
 
 var (
-	// ErrDataNotFound for not found data error
-	ErrDataNotFound = fmt.Errorf("%s data not found", logPrefix)
-	// ErrDatabaseQueryTimeout for underlying data query timeout error
-	ErrDatabaseQueryTimeout = fmt.Errorf("%s upderlying data query timeout", logPrefix)
-
 	dbQueryTimeout  = config.Config.HTTPRequestTimeout
 	groupcacheBytes = config.Config.CacheBytes
+	shutdownTimeout = config.Config.NodeShutdownTimeout
 
 	httpGetter = mock.HTTPGetter(mock.HTTPGetterFunc(http.Get))
 	httpPoster = mock.HTTPPoster(mock.HTTPPosterFunc(http.Post))
@@ -52,8 +59,11 @@ var (
 )
 
 type masterParam struct {
-	Peers []string `json:"peers"`
-	DBs   []string `json:"dbs"`
+	Peers            []string    `json:"peers"`
+	DBs              []string    `json:"dbs"`
+	Role             master.Role `json:"role"`
+	ParticipantAddrs []string    `json:"participantAddrs"`
+	Epoch            uint64      `json:"epoch"`
 }
 
 // Node for one groupcache server
@@ -62,72 +72,168 @@ type Node struct {
 	sync.RWMutex // protect updating for dbs and peers
 	// underlying database
 	dbs []string
-	// fast db
-	fastDB string
+	// scorer ranks dbs by latency/health and drives the hedged-request fetchData path
+	scorer *dbScorer
 	// cache peers
 	peers []string
-	// master url for update meta(dbs and peers)
-	masterAddr      string
-	masterRPCClient mock.RPCClient
+	// role reported by the master: participant or standby
+	role master.Role
+	// httpAddrs of the current participants, used by a standby to forward reads
+	participantAddrs []string
+	// forwardCounter round-robins requests to participantAddrs
+	forwardCounter uint64
+	// epoch is the last membership epoch this node applied; a /meta push carrying an
+	// older epoch is a heartbeat reordered behind another node's graceful leave, and is rejected
+	epoch uint64
+	// inFlight tracks outstanding handleGetKey requests so drain can wait for them to finish
+	inFlight sync.WaitGroup
+	// draining is set once drain starts, so handleGetKey 503s instead of serving from a node
+	// that already told the master it left; use atomic since handleGetKey only reads it
+	draining int32
+	// master addrs for update meta(dbs and peers); masterLeaderIdx is this node's
+	// current guess at which one is the Raft leader, updated on redirect/success
+	masterAddrs     []string
+	masterLeaderIdx int
+	dialMaster      func(addr string) (mock.RPCClient, error)
 
 	// node http server
 	*gin.Engine
 	httpAddr string
 
 	// groupcache server
-	nodeAddr string
-	pool     *groupcache.HTTPPool
-	group    *groupcache.Group
+	nodeAddr    string
+	pool        *groupcache.HTTPPool
+	group       *groupcache.Group
+	groupServer *http.Server
 }
 
-// New returns a new Node with the given info
-func New(httpAddr string, nodeAddr string, masterAddr string) *Node {
+// New returns a new Node with the given info. masterAddrs lists every known master
+// replica; the node tries them in order and follows leader redirects on failover.
+func New(httpAddr string, nodeAddr string, masterAddrs ...string) *Node {
+	addrs := make([]string, len(masterAddrs))
+	for i, addr := range masterAddrs {
+		addrs[i] = strings.TrimSuffix(addr, "/")
+	}
+
 	cache := &Node{
-		masterAddr: strings.TrimSuffix(masterAddr, "/"),
-		httpAddr:   httpAddr,
-		nodeAddr:   nodeAddr,
-		pool:       newPool(nodeAddr),
+		masterAddrs: addrs,
+		httpAddr:    httpAddr,
+		nodeAddr:    nodeAddr,
+		pool:        newPool(nodeAddr),
+		dialMaster:  func(addr string) (mock.RPCClient, error) { return rpc.DialHTTP("tcp", addr) },
+		scorer:      newDBScorer(),
 	}
+	cache.groupServer = &http.Server{Addr: nodeAddr, Handler: cache.pool}
 
 	cache.Engine = newServer(cache)
 	cache.group = newGroup(cache, defaultGroup)
 
-	client, err := rpc.DialHTTP("tcp", masterAddr)
-	if err != nil {
-		log.Internal.Errorf("fail rpc dialing, err: %v", err)
-	}
-	cache.masterRPCClient = client
-
 	return cache
 }
 
 // Start starts the server
 func (node *Node) Start() {
-	// try to get meta data
-	if err := node.join(); err != nil {
-		log.Internal.Fatalf("%s fail join to master, err: %v", logPrefix, err)
-	}
+	// try to get meta data, tolerating the master cluster being briefly unreachable
+	// (e.g. mid-election) by retrying with exponential backoff instead of failing fast
+	node.joinWithRetry()
 
 	// start the groupcache server
 	go func() {
-		log.DB.Fatal(logPrefix, http.ListenAndServe(node.nodeAddr, node.pool))
+		if err := node.groupServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.DB.Fatal(logPrefix, err)
+		}
+	}()
+
+	// leave the cluster and drain in-flight requests on SIGTERM/SIGINT, so a rolling
+	// restart doesn't rely on the master's heartbeat timeout to notice the node is gone
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-sigCh
+		node.drain()
+		os.Exit(0)
 	}()
 
 	// start the node server
 	node.Run(node.httpAddr)
 }
 
+// drain leaves the cluster, then waits for in-flight handleGetKey requests to finish
+// (bounded by shutdownTimeout) before closing the groupcache server listener
+func (node *Node) drain() {
+	log.Internal.Infof("%s draining, leaving cluster", logPrefix)
+	atomic.StoreInt32(&node.draining, 1)
+
+	if err := node.leave(); err != nil {
+		log.Internal.Errorln(logPrefix, "fail leave cluster, err:", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		node.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		log.Internal.Errorln(logPrefix, "drain timed out waiting for in-flight requests")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := node.groupServer.Shutdown(ctx); err != nil {
+		log.Internal.Errorln(logPrefix, "fail shutdown groupcache server, err:", err)
+	}
+}
+
+// leave calls Master.LeaveNode so the cluster drops this node immediately instead of
+// waiting for a heartbeat to fail
+func (node *Node) leave() error {
+	args := &master.LeaveParam{HTTPAddr: node.httpAddr}
+	reply := &master.LeaveReply{}
+	return node.callMaster("Master.LeaveNode", args, reply)
+}
+
+// joinWithRetry calls join, retrying with exponential backoff until it succeeds
+func (node *Node) joinWithRetry() {
+	backoff := initialJoinBackoff
+	for {
+		err := node.join()
+		if err == nil {
+			return
+		}
+
+		log.Internal.Errorf("%s fail join to master, retrying in %s, err: %v", logPrefix, backoff, err)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxJoinBackoff {
+			backoff = maxJoinBackoff
+		}
+	}
+}
+
 func newServer(node *Node) *gin.Engine {
 	server := gin.Default()
+	server.Use(ocerrors.Middleware())
 	server.POST("/meta", node.handleMeta)
 	server.GET("/stats", func(ctx *gin.Context) {
-		ctx.JSON(http.StatusOK, node.group.Stats)
+		ctx.JSON(http.StatusOK, node.statsView())
 	})
 	server.GET("/key/:key", node.handleGetKey)
 	server.GET("/ws/stats", node.handleStatsWebSocket)
+	server.POST("/admin/drain", node.handleAdminDrain)
 	return server
 }
 
+// handleAdminDrain lets an operator trigger the same graceful leave+drain as a SIGTERM,
+// without needing to signal the process directly; it blocks until drain completes.
+func (node *Node) handleAdminDrain(ctx *gin.Context) {
+	node.drain()
+	ctx.JSON(http.StatusOK, nil)
+}
+
 func (node *Node) handleStatsWebSocket(ctx *gin.Context) {
 	conn, err := wsUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
@@ -139,7 +245,7 @@ func (node *Node) handleStatsWebSocket(ctx *gin.Context) {
 	for {
 		select {
 		case <-time.After(time.Second):
-			b, err := json.Marshal(node.group.Stats)
+			b, err := json.Marshal(node.statsView())
 			if err != nil {
 				log.DB.Error(err)
 				continue
@@ -153,24 +259,65 @@ func (node *Node) handleStatsWebSocket(ctx *gin.Context) {
 }
 
 func (node *Node) handleGetKey(ctx *gin.Context) {
+	if atomic.LoadInt32(&node.draining) == 1 {
+		ctx.Error(ocerrors.NewNodeDraining())
+		return
+	}
+
+	node.inFlight.Add(1)
+	defer node.inFlight.Done()
+
+	node.RLock()
+	role := node.role
+	node.RUnlock()
+
+	if role == master.RoleStandby {
+		node.forwardGetKey(ctx)
+		return
+	}
+
 	result := &groupcache.ByteView{}
 	log.DB.Infoln("Start Get")
 	err := node.group.Get(ctx.Request.Context(), ctx.Param("key"), groupcache.ByteViewSink(result))
 	log.DB.Infoln("End Get")
-	if err == ErrDataNotFound {
-		ctx.JSON(http.StatusNotFound, nil)
+	if err != nil {
+		if !ocerrors.IsNotFound(err) {
+			log.DB.Error(logPrefix, err)
+		}
+		ctx.Error(err)
 		return
 	}
 
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
+	ctx.Writer.Write(result.ByteSlice())
+}
+
+// forwardGetKey round-robins a key lookup to one of the known participant peers,
+// since a standby node is kept out of the groupcache ring and holds no data itself
+func (node *Node) forwardGetKey(ctx *gin.Context) {
+	node.RLock()
+	addrs := node.participantAddrs
+	node.RUnlock()
+
+	if len(addrs) == 0 {
+		ctx.JSON(http.StatusServiceUnavailable, nil)
+		return
+	}
+
+	idx := atomic.AddUint64(&node.forwardCounter, 1) % uint64(len(addrs))
+	target := addrs[idx]
+
+	resp, err := httpGetter.Get(fmt.Sprintf(keyURLFormat, urlutil.MakeURL(target), ctx.Param("key")))
 	if err != nil {
-		log.DB.Error(logPrefix, err)
+		log.DB.Error(logPrefix, "fail forwarding key, err:", err)
 		ctx.JSON(http.StatusInternalServerError, nil)
 		return
 	}
+	defer resp.Body.Close()
 
-	ctx.Writer.WriteHeader(http.StatusOK)
-	ctx.Writer.Header()["Content-Type"] = []string{"application/json; charset=utf-8"}
-	ctx.Writer.Write(result.ByteSlice())
+	ctx.Writer.WriteHeader(resp.StatusCode)
+	io.Copy(ctx.Writer, resp.Body)
 }
 
 func newPool(addr string) *groupcache.HTTPPool {
@@ -184,6 +331,89 @@ func newGroup(n *Node, name string) *groupcache.Group {
 	return groupcache.NewGroup(name, groupcacheBytes, groupcache.GetterFunc(n.fetchData))
 }
 
+// callMaster calls serviceMethod on the master cluster, starting from this node's
+// current leader guess and following "not leader, try: <addr>" redirects; if a master
+// is simply unreachable it moves on to the next known addr instead of redirecting.
+func (node *Node) callMaster(serviceMethod string, args, reply interface{}) error {
+	node.RLock()
+	addr := node.masterAddrs[node.masterLeaderIdx%len(node.masterAddrs)]
+	node.RUnlock()
+
+	var lastErr error
+	for attempt := 0; attempt < len(node.masterAddrs); attempt++ {
+		client, err := node.dialMaster(addr)
+		if err != nil {
+			lastErr = err
+			addr = node.nextMasterAddr(addr)
+			continue
+		}
+
+		err = client.Call(serviceMethod, args, reply)
+		client.Close()
+		if err == nil {
+			node.setLeaderAddr(addr)
+			return nil
+		}
+
+		lastErr = err
+		if _, ok := ocerrors.ParseCode(err); ok {
+			// a coded error is the master's definitive answer, not a failover case; return
+			// it unwrapped so the caller can still read its code with ParseCode
+			return err
+		}
+
+		if leader := parseNotLeaderAddr(err); leader != "" {
+			addr = leader
+			continue
+		}
+
+		addr = node.nextMasterAddr(addr)
+	}
+
+	return fmt.Errorf("%s exhausted master addrs %v, last err: %v", logPrefix, node.masterAddrs, lastErr)
+}
+
+// nextMasterAddr returns the master addr immediately after cur in masterAddrs, wrapping
+// around; if cur isn't a known addr (e.g. a redirect target) it starts back from the top
+func (node *Node) nextMasterAddr(cur string) string {
+	node.RLock()
+	defer node.RUnlock()
+
+	for i, addr := range node.masterAddrs {
+		if addr == cur {
+			return node.masterAddrs[(i+1)%len(node.masterAddrs)]
+		}
+	}
+
+	return node.masterAddrs[0]
+}
+
+func (node *Node) setLeaderAddr(addr string) {
+	node.Lock()
+	defer node.Unlock()
+
+	for i, a := range node.masterAddrs {
+		if a == addr {
+			node.masterLeaderIdx = i
+			return
+		}
+	}
+
+	// a redirect pointed us at a master not in our original list; track it anyway
+	node.masterAddrs = append(node.masterAddrs, addr)
+	node.masterLeaderIdx = len(node.masterAddrs) - 1
+}
+
+// parseNotLeaderAddr extracts the leader addr from a master.NotLeaderErrPrefix error, or "" if err doesn't match
+func parseNotLeaderAddr(err error) string {
+	idx := strings.Index(err.Error(), master.NotLeaderErrPrefix)
+	if idx < 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(err.Error()[idx+len(master.NotLeaderErrPrefix):])
+}
+
 func (node *Node) join() error {
 	// build join param
 	args := &master.JoinParam{
@@ -191,7 +421,11 @@ func (node *Node) join() error {
 		NodeAddr: node.nodeAddr,
 	}
 	reply := &master.PeerParam{}
-	if err := node.masterRPCClient.Call("Master.JoinNode", args, reply); err != nil {
+	if err := node.callMaster("Master.JoinNode", args, reply); err != nil {
+		if code, ok := ocerrors.ParseCode(err); ok && code == ocerrors.CodeClusterFull {
+			return fmt.Errorf("%s cluster is full, err: %v", logPrefix, err)
+		}
+
 		return fmt.Errorf("fail call Master.JoinNode, err: %v", err)
 	}
 	log.Internal.Infof("%s join reply: %v", logPrefix, reply)
@@ -199,8 +433,19 @@ func (node *Node) join() error {
 	node.Lock()
 	defer node.Unlock()
 
+	// reject the same way handleMeta does: a redirect/retry in joinWithRetry could land on a
+	// stale replica whose reply epoch is behind what this node already applied
+	if reply.Epoch < node.epoch {
+		return fmt.Errorf("%s stale join reply epoch %d < %d", logPrefix, reply.Epoch, node.epoch)
+	}
+
 	// update meta
-	node.pool.Set(reply.Peers...)
+	node.role = reply.Role
+	node.participantAddrs = reply.ParticipantAddrs
+	node.epoch = reply.Epoch
+	if node.role == master.RoleParticipant {
+		node.pool.Set(reply.Peers...)
+	}
 	node.peers = reply.Peers
 	node.dbs = reply.DBs
 	return nil
@@ -209,7 +454,7 @@ func (node *Node) join() error {
 func (node *Node) handleMeta(ctx *gin.Context) {
 	params := masterParam{}
 	if err := ctx.BindJSON(&params); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(ocerrors.NewBadMetaParams(err.Error()))
 		return
 	}
 
@@ -217,15 +462,25 @@ func (node *Node) handleMeta(ctx *gin.Context) {
 	sort.StringSlice(params.DBs).Sort()
 
 	node.RLock()
-	if reflect.DeepEqual(node.peers, params.Peers) &&
-		reflect.DeepEqual(node.dbs, params.DBs) {
+	stale := params.Epoch < node.epoch
+	noChange := !stale &&
+		reflect.DeepEqual(node.peers, params.Peers) &&
+		reflect.DeepEqual(node.dbs, params.DBs) &&
+		node.role == params.Role &&
+		node.epoch == params.Epoch
+	node.RUnlock()
+
+	if stale {
+		// a heartbeat reordered behind another node's graceful leave; ignore it rather
+		// than letting it resurrect a membership state the master has already moved past
+		ctx.Error(ocerrors.NewStaleEpoch())
+		return
+	}
 
-		node.RUnlock()
-		// return if no changes
+	if noChange {
 		ctx.JSON(http.StatusOK, nil)
 		return
 	}
-	node.RUnlock()
 
 	log.Biz.Infof("%s [peers] local:%#v, remote: %#v\n", logPrefix, node.peers, params.Peers)
 	log.Biz.Infof("%s [dbs] local:%#v, remote: %#v\n", logPrefix, node.dbs, params.DBs)
@@ -233,31 +488,100 @@ func (node *Node) handleMeta(ctx *gin.Context) {
 	node.Lock()
 	defer node.Unlock()
 
-	node.pool.Set(params.Peers...)
+	node.role = params.Role
+	node.participantAddrs = params.ParticipantAddrs
+	node.epoch = params.Epoch
+	if node.role == master.RoleParticipant {
+		node.pool.Set(params.Peers...)
+	}
 	node.peers = params.Peers
 	node.dbs = params.DBs
 
 	ctx.JSON(http.StatusOK, nil)
 }
 
+// fetchData picks the top-scoring healthy db and issues a primary request; if it hasn't
+// returned within the db's hedge delay, a secondary request fans out to the next-best db
+// and fetchData takes whichever comes back first, updating scores for both.
 func (node *Node) fetchData(ctx groupcache.Context, key string, dest groupcache.Sink) error {
-	if node.fastDB == "" {
-		return node.tryAllDBFind(ctx, key, dest)
+	node.RLock()
+	dbs := make([]string, len(node.dbs))
+	copy(dbs, node.dbs)
+	node.RUnlock()
+
+	log.Biz.Infoln(logPrefix, "start fetchData:", time.Now(), dbs)
+	if len(dbs) == 0 {
+		return ocerrors.NewDatabasesUnavailable()
 	}
 
-	data, err := node.find(key, node.fastDB)
-	if err == ErrDataNotFound {
-		return err
+	ranked := node.scorer.rank(dbs)
+	if len(ranked) == 0 {
+		return ocerrors.NewDatabasesUnavailable()
 	}
 
-	if err != nil {
-		log.DB.Error(logPrefix, err)
-		go node.setFastDB("")
-		return node.tryAllDBFind(ctx, key, dest)
+	type result struct {
+		data []byte
+		err  error
 	}
 
-	dest.SetBytes(data)
-	return nil
+	results := make(chan result, 2)
+	request := func(db string) {
+		start := time.Now()
+		data, err := node.find(key, db)
+		if err != nil && !ocerrors.IsNotFound(err) {
+			node.scorer.recordFailure(db)
+		} else {
+			node.scorer.recordSuccess(db, time.Since(start))
+		}
+
+		results <- result{data: data, err: err}
+	}
+
+	go request(ranked[0])
+
+	hedgeTimer := time.NewTimer(node.scorer.hedgeDelay(ranked[0]))
+	defer hedgeTimer.Stop()
+	timeout := time.NewTimer(dbQueryTimeout)
+	defer timeout.Stop()
+
+	hedged := len(ranked) < 2
+	inFlight := 1
+
+	for {
+		select {
+		case res := <-results:
+			inFlight--
+			if ocerrors.IsNotFound(res.err) {
+				return res.err
+			}
+
+			if res.err == nil {
+				dest.SetBytes(res.data)
+				return nil
+			}
+
+			if !hedged {
+				hedged = true
+				inFlight++
+				go request(ranked[1])
+				continue
+			}
+
+			if inFlight == 0 {
+				return res.err
+			}
+
+		case <-hedgeTimer.C:
+			if !hedged {
+				hedged = true
+				inFlight++
+				go request(ranked[1])
+			}
+
+		case <-timeout.C:
+			return ocerrors.NewDatabaseTimeout()
+		}
+	}
 }
 
 func (node *Node) find(key string, url string) ([]byte, error) {
@@ -269,7 +593,7 @@ func (node *Node) find(key string, url string) ([]byte, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, ErrDataNotFound
+		return nil, ocerrors.NewDataNotFound(key)
 	}
 
 	if resp.StatusCode == http.StatusOK {
@@ -279,67 +603,24 @@ func (node *Node) find(key string, url string) ([]byte, error) {
 		}
 
 		if len(b) == 0 {
-			return nil, fmt.Errorf("%s database error, lost data of key: %s\n", logPrefix, key)
+			return nil, ocerrors.NewDatabaseDataLost(key)
 		}
 
 		return b, nil
 	}
 
-	return nil, fmt.Errorf("%s failed to fetch data", logPrefix)
+	return nil, ocerrors.NewDatabasesUnavailable()
 }
 
-func (node *Node) tryAllDBFind(ctx groupcache.Context, key string, dest groupcache.Sink) error {
-	dbs := make([]string, len(node.dbs))
-	copy(dbs, node.dbs)
-	log.Biz.Infoln(logPrefix, "start fetchData:", time.Now(), dbs)
-	if len(dbs) == 0 {
-		return fmt.Errorf("%s databases are not available\n", logPrefix)
-	}
-
-	var got bool
-	var data = make(chan []byte)
-	var completeCount int
-	var fastURL string
-	var resErr error
-
-	for _, db := range dbs {
-		go func(url string) {
-			val, err := node.find(key, url)
-
-			node.Lock()
-			defer node.Unlock()
-			if len(val) > 0 || err == ErrDataNotFound || completeCount == len(dbs) {
-				if !got {
-					got = true
-					fastURL = url
-					resErr = err
-
-					go func() { data <- val }()
-				}
-			}
-		}(db)
-	}
-
-	select {
-	case <-time.After(dbQueryTimeout):
-		go node.setFastDB("")
-		return ErrDatabaseQueryTimeout
-
-	case value := <-data:
-		log.Biz.Infoln(logPrefix, "end get:", time.Now())
-		dest.SetBytes(value)
-
-		if len(value) > 0 || resErr == ErrDataNotFound {
-			go node.setFastDB(fastURL)
-		}
-
-		return resErr
-	}
+// statsView is the JSON payload served on /stats and streamed over /ws/stats
+type statsView struct {
+	Groupcache groupcache.Stats `json:"groupcache"`
+	DBs        []dbStatView     `json:"dbs"`
 }
 
-func (node *Node) setFastDB(db string) {
-	node.Lock()
-	defer node.Unlock()
-
-	node.fastDB = db
+func (node *Node) statsView() statsView {
+	return statsView{
+		Groupcache: node.group.Stats,
+		DBs:        node.scorer.Snapshot(),
+	}
 }
@@ -0,0 +1,173 @@
+// Package errors provides a structured, numerically-coded error type shared by the
+// node and master HTTP/RPC handlers, so clients can react to specific failures instead
+// of string-matching messages.
+package errors
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Error codes are grouped by subsystem: 1xx meta (join/master), 2xx cache, 3xx db.
+const (
+	CodeBadJoinParams     = 101
+	CodeMasterUnreachable = 102
+	CodeClusterFull       = 103
+	CodeBadMetaParams     = 104
+	CodeStaleEpoch        = 105
+
+	CodeDataNotFound = 201
+	CodeNodeDraining = 202
+
+	CodeDatabaseTimeout      = 301
+	CodeDatabasesUnavailable = 302
+	CodeDatabaseDataLost     = 303
+)
+
+// Error is a numerically-coded error carrying both a stable code for programmatic
+// handling and a human Message/Cause for logs and API responses.
+type Error struct {
+	Code    int    `json:"errorCode"`
+	Message string `json:"message"`
+	Cause   string `json:"cause,omitempty"`
+	Status  int    `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Cause == "" {
+		return fmt.Sprintf("[%d] %s", e.Code, e.Message)
+	}
+
+	return fmt.Sprintf("[%d] %s, cause: %s", e.Code, e.Message, e.Cause)
+}
+
+// NewBadJoinParams reports a JoinNode/JoinRaftCluster call missing a required field
+func NewBadJoinParams(field string) *Error {
+	return &Error{
+		Code:    CodeBadJoinParams,
+		Message: "bad join params",
+		Cause:   field,
+		Status:  http.StatusBadRequest,
+	}
+}
+
+// NewBadMetaParams reports a malformed /meta heartbeat payload
+func NewBadMetaParams(cause string) *Error {
+	return &Error{
+		Code:    CodeBadMetaParams,
+		Message: "bad meta params",
+		Cause:   cause,
+		Status:  http.StatusBadRequest,
+	}
+}
+
+// NewStaleEpoch reports a /meta push carrying an epoch older than the node already applied,
+// e.g. a heartbeat reordered behind the membership update pushed for another node's graceful leave
+func NewStaleEpoch() *Error {
+	return &Error{
+		Code:    CodeStaleEpoch,
+		Message: "stale epoch",
+		Status:  http.StatusConflict,
+	}
+}
+
+// NewMasterUnreachable reports that no configured master could be reached
+func NewMasterUnreachable() *Error {
+	return &Error{
+		Code:    CodeMasterUnreachable,
+		Message: "master unreachable",
+		Status:  http.StatusServiceUnavailable,
+	}
+}
+
+// NewClusterFull reports that the cluster already holds its maximum number of joined
+// nodes (participants plus standbys)
+func NewClusterFull() *Error {
+	return &Error{
+		Code:    CodeClusterFull,
+		Message: "cluster full",
+		Status:  http.StatusServiceUnavailable,
+	}
+}
+
+// NewDataNotFound reports that key has no value in any backing database
+func NewDataNotFound(key string) *Error {
+	return &Error{
+		Code:    CodeDataNotFound,
+		Message: "data not found",
+		Cause:   key,
+		Status:  http.StatusNotFound,
+	}
+}
+
+// NewNodeDraining reports that this node has left the cluster and is draining in-flight
+// requests ahead of shutdown, so it no longer accepts new key lookups
+func NewNodeDraining() *Error {
+	return &Error{
+		Code:    CodeNodeDraining,
+		Message: "node draining",
+		Status:  http.StatusServiceUnavailable,
+	}
+}
+
+// NewDatabaseTimeout reports that querying the backing databases timed out
+func NewDatabaseTimeout() *Error {
+	return &Error{
+		Code:    CodeDatabaseTimeout,
+		Message: "database query timeout",
+		Status:  http.StatusGatewayTimeout,
+	}
+}
+
+// NewDatabasesUnavailable reports that no backing database can serve the request: none is
+// known, every known one has an open circuit, or a database answered with an unexpected status
+func NewDatabasesUnavailable() *Error {
+	return &Error{
+		Code:    CodeDatabasesUnavailable,
+		Message: "databases unavailable",
+		Status:  http.StatusServiceUnavailable,
+	}
+}
+
+// NewDatabaseDataLost reports that a database returned 200 OK with an empty body for key
+func NewDatabaseDataLost(key string) *Error {
+	return &Error{
+		Code:    CodeDatabaseDataLost,
+		Message: "database lost data",
+		Cause:   key,
+		Status:  http.StatusInternalServerError,
+	}
+}
+
+// ParseCode extracts the numeric code from a *Error's "[code] message" form. It also
+// recognizes errors that crossed an RPC boundary as plain strings (net/rpc drops the
+// original type), so callers can react to codes like CodeClusterFull from a remote call.
+func ParseCode(err error) (int, bool) {
+	if err == nil {
+		return 0, false
+	}
+
+	if e, ok := err.(*Error); ok {
+		return e.Code, true
+	}
+
+	var code int
+	if _, scanErr := fmt.Sscanf(err.Error(), "[%d]", &code); scanErr != nil {
+		return 0, false
+	}
+
+	return code, true
+}
+
+// IsNotFound reports whether err is a *Error with CodeDataNotFound, the structured
+// replacement for the old `err == node.ErrDataNotFound` sentinel comparison
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == CodeDataNotFound
+}
+
+// IsDatabaseTimeout reports whether err is a *Error with CodeDatabaseTimeout
+func IsDatabaseTimeout(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == CodeDatabaseTimeout
+}
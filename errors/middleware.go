@@ -0,0 +1,33 @@
+package errors
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware writes a uniform {"errorCode","message","cause"} JSON envelope for any
+// *Error attached to the context via ctx.Error(...), with the status carried on Error.Status.
+// Handlers that already wrote a response themselves are left untouched.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if ctx.Writer.Written() || len(ctx.Errors) == 0 {
+			return
+		}
+
+		err := ctx.Errors.Last().Err
+		e, ok := err.(*Error)
+		if !ok {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"errorCode": 0, "message": err.Error()})
+			return
+		}
+
+		ctx.JSON(e.Status, gin.H{
+			"errorCode": e.Code,
+			"message":   e.Message,
+			"cause":     e.Cause,
+		})
+	}
+}